@@ -0,0 +1,173 @@
+// Package logger provides a small leveled logger with two output modes:
+// colored text for interactive TTYs, and single-line JSON for log
+// aggregators and Bitrise's own log parser.
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Level identifies the severity of a log event.
+type Level string
+
+const (
+	Debug Level = "DEBUG"
+	Info  Level = "INFO"
+	Warn  Level = "WARN"
+	Error Level = "ERROR"
+)
+
+// Format selects how events are rendered.
+type Format string
+
+const (
+	// FormatText renders events as colored, human-readable lines.
+	FormatText Format = "text"
+	// FormatJSON renders events as one JSON object per line.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat maps a log_format input value to a Format, defaulting to
+// FormatText for an empty or unrecognized value.
+func ParseFormat(value string) Format {
+	if Format(value) == FormatJSON {
+		return FormatJSON
+	}
+	return FormatText
+}
+
+// Fields is a set of structured key/value pairs attached to a log event.
+type Fields map[string]interface{}
+
+// Logger renders log events in either text or JSON form.
+type Logger struct {
+	format Format
+	isTTY  bool
+}
+
+// New creates a Logger that renders in format. When format is FormatText
+// and stdout is not a terminal, ANSI color codes are omitted.
+func New(format Format) *Logger {
+	return &Logger{format: format, isTTY: isTerminal(os.Stdout)}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (info.Mode() & os.ModeCharDevice) != 0
+}
+
+// Entry is a Logger bound to a fixed set of structured fields.
+type Entry struct {
+	logger *Logger
+	fields Fields
+}
+
+// WithField returns an Entry carrying the given key/value in addition to
+// any fields already on the Logger.
+func (l *Logger) WithField(key string, value interface{}) *Entry {
+	return l.WithFields(Fields{key: value})
+}
+
+// WithFields returns an Entry carrying the given fields.
+func (l *Logger) WithFields(fields Fields) *Entry {
+	return &Entry{logger: l, fields: fields}
+}
+
+func (l *Logger) log(level Level, kind, msg string) {
+	l.WithFields(nil).log(level, kind, msg)
+}
+
+// Debugf logs a DEBUG-level event.
+func (l *Logger) Debugf(format string, v ...interface{}) { l.log(Debug, "", fmt.Sprintf(format, v...)) }
+
+// Infof logs an INFO-level event.
+func (l *Logger) Infof(format string, v ...interface{}) { l.log(Info, "", fmt.Sprintf(format, v...)) }
+
+// Detailf logs an indented INFO-level detail line, used for listing
+// configuration or response fields under a preceding Infof header.
+func (l *Logger) Detailf(format string, v ...interface{}) {
+	l.log(Info, "detail", fmt.Sprintf(format, v...))
+}
+
+// Donef logs a successful INFO-level event.
+func (l *Logger) Donef(format string, v ...interface{}) {
+	l.log(Info, "done", fmt.Sprintf(format, v...))
+}
+
+// Warnf logs a WARN-level event.
+func (l *Logger) Warnf(format string, v ...interface{}) { l.log(Warn, "", fmt.Sprintf(format, v...)) }
+
+// Errorf logs an ERROR-level event.
+func (l *Logger) Errorf(format string, v ...interface{}) { l.log(Error, "", fmt.Sprintf(format, v...)) }
+
+func (e *Entry) log(level Level, kind, msg string) {
+	if e.logger.format == FormatJSON {
+		e.writeJSON(level, msg)
+		return
+	}
+	e.writeText(level, kind, msg)
+}
+
+// Debugf logs a DEBUG-level event with the Entry's fields.
+func (e *Entry) Debugf(format string, v ...interface{}) { e.log(Debug, "", fmt.Sprintf(format, v...)) }
+
+// Infof logs an INFO-level event with the Entry's fields.
+func (e *Entry) Infof(format string, v ...interface{}) { e.log(Info, "", fmt.Sprintf(format, v...)) }
+
+// Warnf logs a WARN-level event with the Entry's fields.
+func (e *Entry) Warnf(format string, v ...interface{}) { e.log(Warn, "", fmt.Sprintf(format, v...)) }
+
+// Errorf logs an ERROR-level event with the Entry's fields.
+func (e *Entry) Errorf(format string, v ...interface{}) { e.log(Error, "", fmt.Sprintf(format, v...)) }
+
+func (e *Entry) writeJSON(level Level, msg string) {
+	line := struct {
+		Ts     string `json:"ts"`
+		Level  Level  `json:"level"`
+		Msg    string `json:"msg"`
+		Fields Fields `json:"fields,omitempty"`
+	}{
+		Ts:     time.Now().UTC().Format(time.RFC3339),
+		Level:  level,
+		Msg:    msg,
+		Fields: e.fields,
+	}
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		fmt.Println(msg)
+		return
+	}
+	fmt.Println(string(encoded))
+}
+
+func (e *Entry) writeText(level Level, kind, msg string) {
+	color := func(code, s string) string {
+		if !e.logger.isTTY {
+			return s
+		}
+		return fmt.Sprintf("\x1b[%sm%s\x1b[0m", code, s)
+	}
+
+	switch {
+	case kind == "done":
+		fmt.Printf("  %s\n", color("32;1", msg))
+	case kind == "detail":
+		fmt.Printf("  %s\n", msg)
+	case level == Info:
+		fmt.Println()
+		fmt.Printf("%s\n", color("34;1", msg))
+	case level == Warn:
+		fmt.Printf("%s\n", color("33;1", msg))
+	case level == Error:
+		fmt.Printf("%s\n", color("31;1", msg))
+	default:
+		fmt.Printf("%s\n", msg)
+	}
+}
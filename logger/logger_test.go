@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  Format
+	}{
+		{"json", "json", FormatJSON},
+		{"text", "text", FormatText},
+		{"empty defaults to text", "", FormatText},
+		{"unrecognized defaults to text", "yaml", FormatText},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ParseFormat(c.value); got != c.want {
+				t.Errorf("ParseFormat(%q) = %s, want %s", c.value, got, c.want)
+			}
+		})
+	}
+}
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	original := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %s", err)
+	}
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = original
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read captured output: %s", err)
+	}
+	return string(out)
+}
+
+func TestLoggerJSONOutput(t *testing.T) {
+	l := New(FormatJSON)
+
+	out := captureStdout(t, func() {
+		l.WithField("key", "value").Infof("hello %s", "world")
+	})
+
+	var line struct {
+		Ts     string            `json:"ts"`
+		Level  string            `json:"level"`
+		Msg    string            `json:"msg"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &line); err != nil {
+		t.Fatalf("output is not valid JSON: %s (output: %q)", err, out)
+	}
+
+	if line.Level != string(Info) {
+		t.Errorf("level = %q, want %q", line.Level, Info)
+	}
+	if line.Msg != "hello world" {
+		t.Errorf("msg = %q, want %q", line.Msg, "hello world")
+	}
+	if line.Fields["key"] != "value" {
+		t.Errorf("fields[key] = %q, want %q", line.Fields["key"], "value")
+	}
+	if line.Ts == "" {
+		t.Error("ts is empty")
+	}
+}
+
+func TestLoggerTextOutputIsNotJSON(t *testing.T) {
+	l := New(FormatText)
+
+	out := captureStdout(t, func() {
+		l.Infof("plain message")
+	})
+
+	if !strings.Contains(out, "plain message") {
+		t.Errorf("output %q does not contain the logged message", out)
+	}
+
+	var discard interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &discard); err == nil {
+		t.Errorf("text-format output unexpectedly parses as JSON: %q", out)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// -----------------------
+// --- Notifications
+// -----------------------
+
+// BuildMetadata carries the values a notification_template_path template
+// can reference when rendering release notes.
+type BuildMetadata struct {
+	GitSHA           string
+	Branch           string
+	BuildNumber      string
+	PreviousBuildURL string
+}
+
+// buildMetadataFromEnv reads the metadata Bitrise exposes for the current
+// build, plus the build URL of the previous INSTALLRAPP_DEPLOY_JSON export
+// (if this step ran earlier in the same workflow).
+func buildMetadataFromEnv() BuildMetadata {
+	metadata := BuildMetadata{
+		GitSHA:      os.Getenv("GIT_CLONE_COMMIT_HASH"),
+		Branch:      os.Getenv("BITRISE_GIT_BRANCH"),
+		BuildNumber: os.Getenv("BITRISE_BUILD_NUMBER"),
+	}
+
+	if previousJSON := os.Getenv(installrAppDeployJson); previousJSON != "" {
+		var previous InstallrAppResponse
+		if err := json.Unmarshal([]byte(previousJSON), &previous); err == nil {
+			metadata.PreviousBuildURL = previous.AppData.LatestBuild.BuildFile.Url
+		}
+	}
+
+	return metadata
+}
+
+// renderNotes renders templatePath as a text/template with metadata and
+// the existing notes available. When templatePath is empty, notes is
+// returned unchanged.
+func renderNotes(templatePath, notes string, metadata BuildMetadata) (string, error) {
+	if templatePath == "" {
+		return notes, nil
+	}
+
+	tmplContents, err := ioutil.ReadFile(templatePath)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(filepath.Base(templatePath)).Parse(string(tmplContents))
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		BuildMetadata
+		Notes string
+	}{BuildMetadata: metadata, Notes: notes}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
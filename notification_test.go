@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderNotes(t *testing.T) {
+	dir := t.TempDir()
+
+	templatePath := filepath.Join(dir, "notes.tmpl")
+	template := "{{.Notes}} ({{.Branch}}@{{.GitSHA}}, build {{.BuildNumber}}, previous: {{.PreviousBuildURL}})"
+	if err := ioutil.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := BuildMetadata{
+		GitSHA:           "abc123",
+		Branch:           "main",
+		BuildNumber:      "42",
+		PreviousBuildURL: "https://example.com/build/41",
+	}
+
+	cases := []struct {
+		name         string
+		templatePath string
+		notes        string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "no template returns notes unchanged",
+			templatePath: "",
+			notes:        "plain release notes",
+			want:         "plain release notes",
+		},
+		{
+			name:         "template is rendered with metadata",
+			templatePath: templatePath,
+			notes:        "fixed a bug",
+			want:         "fixed a bug (main@abc123, build 42, previous: https://example.com/build/41)",
+		},
+		{
+			name:         "missing template file errors",
+			templatePath: filepath.Join(dir, "does-not-exist.tmpl"),
+			notes:        "notes",
+			wantErr:      true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := renderNotes(c.templatePath, c.notes, metadata)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("renderNotes() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && got != c.want {
+				t.Errorf("renderNotes() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestBuildMetadataFromEnv(t *testing.T) {
+	defer os.Unsetenv("GIT_CLONE_COMMIT_HASH")
+	defer os.Unsetenv("BITRISE_GIT_BRANCH")
+	defer os.Unsetenv("BITRISE_BUILD_NUMBER")
+	defer os.Unsetenv(installrAppDeployJson)
+
+	os.Setenv("GIT_CLONE_COMMIT_HASH", "deadbeef")
+	os.Setenv("BITRISE_GIT_BRANCH", "feature/x")
+	os.Setenv("BITRISE_BUILD_NUMBER", "7")
+	os.Setenv(installrAppDeployJson, `{"Result":"success","AppData":{"LatestBuild":{"BuildFile":{"Url":"https://example.com/build/6"}}}}`)
+
+	metadata := buildMetadataFromEnv()
+
+	if metadata.GitSHA != "deadbeef" {
+		t.Errorf("GitSHA = %q, want %q", metadata.GitSHA, "deadbeef")
+	}
+	if metadata.Branch != "feature/x" {
+		t.Errorf("Branch = %q, want %q", metadata.Branch, "feature/x")
+	}
+	if metadata.BuildNumber != "7" {
+		t.Errorf("BuildNumber = %q, want %q", metadata.BuildNumber, "7")
+	}
+	if metadata.PreviousBuildURL != "https://example.com/build/6" {
+		t.Errorf("PreviousBuildURL = %q, want %q", metadata.PreviousBuildURL, "https://example.com/build/6")
+	}
+}
+
+func TestBuildMetadataFromEnvWithInvalidPreviousJSON(t *testing.T) {
+	defer os.Unsetenv(installrAppDeployJson)
+	os.Setenv(installrAppDeployJson, "not json")
+
+	metadata := buildMetadataFromEnv()
+
+	if metadata.PreviousBuildURL != "" {
+		t.Errorf("PreviousBuildURL = %q, want empty on invalid JSON", metadata.PreviousBuildURL)
+	}
+}
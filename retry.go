@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// -----------------------
+// --- Retry
+// -----------------------
+
+// retryConfig holds the tunables for doRequestWithRetry.
+type retryConfig struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// isRetryableStatusCode reports whether a response with the given status
+// code is worth retrying (request timeout, rate limited, or server error).
+func isRetryableStatusCode(statusCode int) bool {
+	if statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return statusCode >= 500 && statusCode <= 599
+}
+
+// backoffDelay returns the delay to wait before attempt number attempt
+// (0-indexed), applying exponential backoff with full jitter, capped at
+// cfg.MaxDelay.
+func backoffDelay(cfg retryConfig, attempt int) time.Duration {
+	delay := cfg.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// retryAfterDelay parses a Retry-After header (seconds form) and returns
+// the delay it specifies, or ok=false if the header is absent or invalid.
+func retryAfterDelay(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// doRequestWithRetry performs the request built by newRequest, retrying on
+// network errors and retryable status codes according to cfg. newRequest is
+// called again before every attempt since an *http.Request's body can only
+// be read once. It returns the last response along with the number of
+// attempts made and the last error, if any.
+func doRequestWithRetry(client *http.Client, cfg retryConfig, newRequest func() (*http.Request, error)) (*http.Response, int, error) {
+	var lastResp *http.Response
+	var lastErr error
+
+	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			logWarn("Retrying request (attempt %d/%d)...", attempt+1, cfg.MaxRetries+1)
+		}
+
+		request, err := newRequest()
+		if err != nil {
+			return nil, attempt + 1, err
+		}
+
+		resp, err := client.Do(request)
+		lastResp, lastErr = resp, err
+
+		if err == nil && !isRetryableStatusCode(resp.StatusCode) {
+			return resp, attempt + 1, nil
+		}
+
+		if attempt == cfg.MaxRetries {
+			break
+		}
+
+		delay := backoffDelay(cfg, attempt)
+		if resp != nil {
+			if retryAfter, ok := retryAfterDelay(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			resp.Body.Close()
+		}
+		if delay > cfg.MaxDelay {
+			delay = cfg.MaxDelay
+		}
+
+		time.Sleep(delay)
+	}
+
+	return lastResp, cfg.MaxRetries + 1, lastErr
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableStatusCode(t *testing.T) {
+	cases := []struct {
+		name       string
+		statusCode int
+		want       bool
+	}{
+		{"request timeout", http.StatusRequestTimeout, true},
+		{"too many requests", http.StatusTooManyRequests, true},
+		{"internal server error", http.StatusInternalServerError, true},
+		{"bad gateway", http.StatusBadGateway, true},
+		{"highest 5xx", 599, true},
+		{"ok", http.StatusOK, false},
+		{"not found", http.StatusNotFound, false},
+		{"bad request", http.StatusBadRequest, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isRetryableStatusCode(c.statusCode); got != c.want {
+				t.Errorf("isRetryableStatusCode(%d) = %v, want %v", c.statusCode, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	cfg := retryConfig{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	cases := []struct {
+		name    string
+		attempt int
+		maxWant time.Duration
+	}{
+		{"first attempt", 0, time.Second},
+		{"second attempt", 1, 2 * time.Second},
+		{"capped by max delay", 10, cfg.MaxDelay},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			delay := backoffDelay(cfg, c.attempt)
+			if delay < 0 || delay > c.maxWant {
+				t.Errorf("backoffDelay(cfg, %d) = %s, want in range [0, %s]", c.attempt, delay, c.maxWant)
+			}
+		})
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   string
+		wantOk   bool
+		wantTime time.Duration
+	}{
+		{"empty header", "", false, 0},
+		{"valid seconds", "5", true, 5 * time.Second},
+		{"zero seconds", "0", true, 0},
+		{"negative seconds", "-1", false, 0},
+		{"not a number", "soon", false, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			delay, ok := retryAfterDelay(c.header)
+			if ok != c.wantOk {
+				t.Fatalf("retryAfterDelay(%q) ok = %v, want %v", c.header, ok, c.wantOk)
+			}
+			if ok && delay != c.wantTime {
+				t.Errorf("retryAfterDelay(%q) = %s, want %s", c.header, delay, c.wantTime)
+			}
+		})
+	}
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/Redth/bitrise-steps-installrapp-deploy/logger"
 )
 
 // -----------------------
@@ -23,7 +24,14 @@ const (
 	installrAppDeployStatusSuccess = "success"
 	installrAppDeployStatusFailed  = "failed"
 	installrAppDeployBuildURLKey   = "INSTALLRAPP_DEPLOY_BUILD_URL"
+	installrAppDeployBuildURLsKey  = "INSTALLRAPP_DEPLOY_BUILD_URLS"
 	installrAppDeployJson          = "INSTALLRAPP_DEPLOY_JSON"
+	installrAppDeployAttemptsKey   = "INSTALLRAPP_DEPLOY_ATTEMPTS"
+	installrAppDeployFinalStateKey = "INSTALLRAPP_DEPLOY_FINAL_STATE"
+
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 2 * time.Second
+	defaultRetryMaxDelay  = 30 * time.Second
 )
 
 // -----------------------
@@ -57,35 +65,33 @@ type InstallrAppResponse struct {
 // --- Functions
 // -----------------------
 
+// log is the step's default logger, configured from the log_format input
+// (text|json, defaulting to text) once at startup.
+var log = logger.New(logger.ParseFormat(os.Getenv("log_format")))
+
 func logFail(format string, v ...interface{}) {
 	if err := exportEnvironmentWithEnvman(installrAppDeployStatusKey, installrAppDeployStatusFailed); err != nil {
 		logWarn("Failed to export %s, error: %s", installrAppDeployStatusKey, err)
 	}
 
-	errorMsg := fmt.Sprintf(format, v...)
-	fmt.Printf("\x1b[31;1m%s\x1b[0m\n", errorMsg)
+	log.Errorf(format, v...)
 	os.Exit(1)
 }
 
 func logWarn(format string, v ...interface{}) {
-	errorMsg := fmt.Sprintf(format, v...)
-	fmt.Printf("\x1b[33;1m%s\x1b[0m\n", errorMsg)
+	log.Warnf(format, v...)
 }
 
 func logInfo(format string, v ...interface{}) {
-	fmt.Println()
-	errorMsg := fmt.Sprintf(format, v...)
-	fmt.Printf("\x1b[34;1m%s\x1b[0m\n", errorMsg)
+	log.Infof(format, v...)
 }
 
 func logDetails(format string, v ...interface{}) {
-	errorMsg := fmt.Sprintf(format, v...)
-	fmt.Printf("  %s\n", errorMsg)
+	log.Detailf(format, v...)
 }
 
 func logDone(format string, v ...interface{}) {
-	errorMsg := fmt.Sprintf(format, v...)
-	fmt.Printf("  \x1b[32;1m%s\x1b[0m\n", errorMsg)
+	log.Donef(format, v...)
 }
 
 func genericIsPathExists(pth string) (os.FileInfo, bool, error) {
@@ -131,35 +137,44 @@ func exportEnvironmentWithEnvman(keyStr, valueStr string) error {
 	return envman.Run()
 }
 
+// createRequest builds a multipart POST request for url, streaming any
+// files straight off disk into the request body via an io.Pipe instead of
+// buffering them in memory, so large IPAs don't need to be fully loaded
+// before the upload starts.
 func createRequest(url string, fields, files map[string]string) (*http.Request, error) {
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-
-	// Add fields
-	for key, value := range fields {
-		if err := w.WriteField(key, value); err != nil {
-			return nil, err
-		}
-	}
-
-	// Add files
-	for key, file := range files {
-		f, err := os.Open(file)
-		if err != nil {
-			return nil, err
-		}
-		fw, err := w.CreateFormFile(key, file)
-		if err != nil {
-			return nil, err
-		}
-		if _, err = io.Copy(fw, f); err != nil {
-			return nil, err
-		}
-	}
-
-	w.Close()
-
-	req, err := http.NewRequest("POST", url, &b)
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+
+	go func() {
+		err := func() error {
+			for key, value := range fields {
+				if err := w.WriteField(key, value); err != nil {
+					return err
+				}
+			}
+
+			for key, file := range files {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				fw, err := w.CreateFormFile(key, file)
+				if err != nil {
+					return err
+				}
+				if _, err = io.Copy(fw, f); err != nil {
+					return err
+				}
+			}
+
+			return w.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("POST", url, pr)
 	if err != nil {
 		return nil, err
 	}
@@ -169,6 +184,36 @@ func createRequest(url string, fields, files map[string]string) (*http.Request,
 	return req, nil
 }
 
+// envDuration reads an environment variable as a number of seconds,
+// falling back to def when unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		logWarn("Invalid value for %s (%s), using default of %s", key, value, def)
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// envInt reads an environment variable as an int, falling back to def
+// when unset or invalid.
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logWarn("Invalid value for %s (%s), using default of %d", key, value, def)
+		return def
+	}
+	return n
+}
+
 // -----------------------
 // --- Main
 // -----------------------
@@ -177,131 +222,208 @@ func main() {
 	//
 	// Validate options
 	ipaPath := os.Getenv("ipa_path")
+	apkPath := os.Getenv("apk_path")
+	aabPath := os.Getenv("aab_path")
+	dsymPath := os.Getenv("dsym_path")
 	apiToken := os.Getenv("api_token")
 	notes := os.Getenv("notes")
 	notify := os.Getenv("notify")
     add := os.Getenv("add")
-	
+	teams := os.Getenv("teams")
+	channel := os.Getenv("channel")
+	notificationTemplatePath := os.Getenv("notification_template_path")
+	dryRun := os.Getenv("dry_run") == "true"
+	webhookURL := os.Getenv("webhook_url")
+	webhookFormat := os.Getenv("webhook_format")
+
+	maxRetries := envInt("max_retries", defaultMaxRetries)
+	retryBaseDelay := envDuration("retry_base_delay", defaultRetryBaseDelay)
+	retryMaxDelay := envDuration("retry_max_delay", defaultRetryMaxDelay)
+	pollTimeout := envDuration("poll_timeout", defaultPollTimeout)
+	pollInterval := envDuration("poll_interval", defaultPollInterval)
+
 	logInfo("Configs:")
 	logDetails("ipa_path: %s", ipaPath)
+	logDetails("apk_path: %s", apkPath)
+	logDetails("aab_path: %s", aabPath)
+	logDetails("dsym_path: %s", dsymPath)
 	logDetails("api_token: ***")
 	logDetails("releaseNotes: %s", notes)
 	logDetails("notify: %s", notify)
     logDetails("add: %s", add)
-	
-	if ipaPath == "" {
-		logFail("Missing required input: ipa_path")
-	}
-	if exist, err := IsPathExists(ipaPath); err != nil {
-		logFail("Failed to check if path (%s) exist, error: %#v", ipaPath, err)
-	} else if !exist {
-		logFail("No IPA found to deploy. Specified path was: %s", ipaPath)
+	logDetails("teams: %s", teams)
+	logDetails("channel: %s", channel)
+	logDetails("notification_template_path: %s", notificationTemplatePath)
+	logDetails("dry_run: %t", dryRun)
+	logDetails("max_retries: %d", maxRetries)
+	logDetails("retry_base_delay: %s", retryBaseDelay)
+	logDetails("retry_max_delay: %s", retryMaxDelay)
+	logDetails("poll_timeout: %s", pollTimeout)
+	logDetails("poll_interval: %s", pollInterval)
+	logDetails("webhook_url: %s", webhookURL)
+	logDetails("webhook_format: %s", webhookFormat)
+	logDetails("log_format: %s", os.Getenv("log_format"))
+
+	if ipaPath == "" && apkPath == "" && aabPath == "" {
+		logFail("Missing required input: at least one of ipa_path, apk_path, aab_path must be set")
 	}
 
 	if apiToken == "" {
 		logFail("No App api_token provided as environment variable. Terminating...")
 	}
 
-	//
-	// Create request
-	logInfo("Performing request")
+	var jobs []UploadJob
+	for _, artifact := range []struct {
+		Type ArtifactType
+		Path string
+	}{
+		{ArtifactTypeIPA, ipaPath},
+		{ArtifactTypeAPK, apkPath},
+		{ArtifactTypeAAB, aabPath},
+		{ArtifactTypeDSYM, dsymPath},
+	} {
+		if artifact.Path == "" {
+			continue
+		}
+		job, err := newUploadJob(artifact.Type, artifact.Path)
+		if err != nil {
+			logFail("%s", err)
+		}
+		jobs = append(jobs, job)
+	}
 
-	requestURL := "https://www.installrapp.com/apps.json"
+	//
+	// Render notes and build the form fields
+	renderedNotes, err := renderNotes(notificationTemplatePath, notes, buildMetadataFromEnv())
+	if err != nil {
+		logFail("Failed to render notification_template_path (%s), error: %s", notificationTemplatePath, err)
+	}
 
 	fields := map[string]string{
-		"releaseNotes":     notes,
+		"releaseNotes":     renderedNotes,
 		"notify":           notify,
         "add":              add,
 	}
-
-	files := map[string]string{
-		"qqfile": ipaPath,
+	if teams != "" {
+		fields["teams"] = teams
 	}
-	
-	request, err := createRequest(requestURL, fields, files)
-	if err != nil {
-		logFail("Failed to create request, error: %#v", err)
+	if channel != "" {
+		fields["channel"] = channel
+	}
+
+	if dryRun {
+		logInfo("Dry run - no artifacts will be uploaded")
+		for _, job := range jobs {
+			logDetails("would upload: %s (%s) to %s", job.Path, job.Type, job.RequestURL())
+		}
+		logDetails("fields: %#v", fields)
+		if err := exportEnvironmentWithEnvman(installrAppDeployStatusKey, "dry_run"); err != nil {
+			logWarn("Failed to export %s, error: %s", installrAppDeployStatusKey, err)
+		}
+		return
 	}
-	request.Header.Add("X-InstallrAppToken", apiToken)
 
+	//
+	// Perform requests
 	client := http.Client{}
-	response, requestErr := client.Do(request)
+	retryCfg := retryConfig{MaxRetries: maxRetries, BaseDelay: retryBaseDelay, MaxDelay: retryMaxDelay}
 
-	defer response.Body.Close()
-	contents, readErr := ioutil.ReadAll(response.Body)
+	var results []UploadResult
+	var buildURLs []string
+	var totalAttempts int
+	var jobErrors []string
+	overallResult := installrAppDeployStatusSuccess
 
-	//
-	// Process response
-
-	// Error
-	if requestErr != nil {
-		if readErr != nil {
-			logWarn("Failed to read response body, error: %#v", readErr)
-		} else {
-			logInfo("Response:")
-			logDetails("status code: %d", response.StatusCode)
-			logDetails("body: %s", string(contents))
+	for _, job := range jobs {
+		logInfo("Uploading %s (%s)", job.Path, job.Type)
+
+		result, err := performUpload(&client, job, apiToken, fields, retryCfg)
+		totalAttempts += result.Attempts
+
+		logInfo("Response:")
+		logDetails("status code: %d", result.StatusCode)
+		logDetails("body: %s", result.RawResponse)
+
+		if err != nil {
+			overallResult = installrAppDeployStatusFailed
+			log.Errorf("Failed to upload %s, error: %s", job.Path, err)
+			jobErrors = append(jobErrors, fmt.Sprintf("%s: %s", job.Path, err))
+			results = append(results, result)
+			continue
 		}
-		logFail("Performing request failed, error: %#v", requestErr)
+
+		logDone("Status: %s", result.Result)
+		if result.BuildURL != "" {
+			logDone("Build URL: %s", result.BuildURL)
+			buildURLs = append(buildURLs, result.BuildURL)
+		}
+
+		results = append(results, result)
 	}
 
-	if response.StatusCode < 200 || response.StatusCode > 300 {
-		if readErr != nil {
-			logWarn("Failed to read response body, error: %#v", readErr)
-		} else {
-			logInfo("Response:")
-			logDetails("status code: %d", response.StatusCode)
-			logDetails("body: %s", string(contents))
+	//
+	// Poll for build processing status
+	finalState := finalStateNotPolled
+	for _, result := range results {
+		if result.Job.Type == ArtifactTypeDSYM || result.AppID == "" {
+			continue
+		}
+
+		logInfo("Polling build status for app %s, build %d", result.AppID, result.BuildID)
+		state, err := pollBuildStatus(&client, apiToken, result.AppID, result.BuildID, pollTimeout, pollInterval)
+		if err != nil {
+			logWarn("Failed to poll build status, error: %s", err)
+			break
 		}
-		logFail("Performing request failed, status code: %d", response.StatusCode)
+		logDone("Final state: %s", state)
+		finalState = state
+		break
 	}
 
-	// Success
-	logDone("Request succeeded")
+	if err := exportEnvironmentWithEnvman(installrAppDeployFinalStateKey, finalState); err != nil {
+		logWarn("Failed to export %s, error: %s", installrAppDeployFinalStateKey, err)
+	}
 
-	logInfo("Response:")
-	logDetails("status code: %d", response.StatusCode)
-	logDetails("body: %s", contents)
+	//
+	// Notify webhook
+	if webhookURL != "" {
+		logInfo("Posting webhook notification")
+		if err := postWebhook(&client, webhookURL, webhookFormat, overallResult, finalState, buildURLs); err != nil {
+			logWarn("Failed to post webhook notification, error: %s", err)
+		}
+	}
 
-	if readErr != nil {
-		logFail("Failed to read response body, error: %#v", readErr)
+	//
+	// Export variables
+	if err := exportEnvironmentWithEnvman(installrAppDeployAttemptsKey, fmt.Sprintf("%d", totalAttempts)); err != nil {
+		logWarn("Failed to export %s, error: %s", installrAppDeployAttemptsKey, err)
 	}
 
-    // Decode the json object
-    iar := &InstallrAppResponse{}
-    if err := json.Unmarshal([]byte(contents), &iar); err != nil {
-    	logFail("Failed to parse response body, error: %#v", err)    
-    }
-    
-    fmt.Println()
-    
-    // Defaults
-    var responseResult = "failed"
-    var responseBuildUrl = ""
-    
-    // See if our decoded object has the fields we want
-    if (iar != nil) {
-        responseResult = iar.Result        
-        responseBuildUrl = iar.AppData.LatestBuild.BuildFile.Url
-    }
-    
-    // Log some info
-    logDone("Status: %s", responseResult)
-    
-	if responseBuildUrl != "" {
-		logDone("Build URL: %s", responseBuildUrl)
-	}
-	
-    // Export our variables
-	if err := exportEnvironmentWithEnvman(installrAppDeployStatusKey, responseResult); err != nil {
+	if err := exportEnvironmentWithEnvman(installrAppDeployStatusKey, overallResult); err != nil {
 		logFail("Failed to export %s, error: %#v", installrAppDeployStatusKey, err)
 	}
 
-	if err := exportEnvironmentWithEnvman(installrAppDeployBuildURLKey, responseBuildUrl); err != nil {
+	var firstBuildURL string
+	if len(buildURLs) > 0 {
+		firstBuildURL = buildURLs[0]
+	}
+	if err := exportEnvironmentWithEnvman(installrAppDeployBuildURLKey, firstBuildURL); err != nil {
 		logFail("Failed to export %s, error: %#v", installrAppDeployBuildURLKey, err)
 	}
 
-	if err := exportEnvironmentWithEnvman(installrAppDeployJson, string(contents)); err != nil {
+	if err := exportEnvironmentWithEnvman(installrAppDeployBuildURLsKey, strings.Join(buildURLs, "\n")); err != nil {
+		logFail("Failed to export %s, error: %#v", installrAppDeployBuildURLsKey, err)
+	}
+
+	lastResponse := ""
+	if len(results) > 0 {
+		lastResponse = results[len(results)-1].RawResponse
+	}
+	if err := exportEnvironmentWithEnvman(installrAppDeployJson, lastResponse); err != nil {
 		logFail("Failed to export %s, error: %#v", installrAppDeployJson, err)
 	}
+
+	if len(jobErrors) > 0 {
+		logFail("Failed to upload %d artifact(s):\n%s", len(jobErrors), strings.Join(jobErrors, "\n"))
+	}
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// -----------------------
+// --- Upload jobs
+// -----------------------
+
+// ArtifactType identifies the kind of build artifact being uploaded.
+type ArtifactType string
+
+const (
+	ArtifactTypeIPA  ArtifactType = "ipa"
+	ArtifactTypeAPK  ArtifactType = "apk"
+	ArtifactTypeAAB  ArtifactType = "aab"
+	ArtifactTypeDSYM ArtifactType = "dsym"
+)
+
+const (
+	installrAppsURL    = "https://www.installrapp.com/apps.json"
+	installrSymbolsURL = "https://www.installrapp.com/apps/symbols.json"
+)
+
+// zipMagicBytes is the local-file-header signature shared by zip-based
+// archives (ipa, apk, aab, and zipped dSYM bundles alike).
+var zipMagicBytes = []byte{0x50, 0x4B, 0x03, 0x04}
+
+// looksLikeZipArchive reports whether path starts with the zip local-file
+// header signature, used as a fallback when a file's extension doesn't
+// identify its artifact type.
+func looksLikeZipArchive(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(zipMagicBytes))
+	if _, err := io.ReadFull(f, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return bytes.Equal(header, zipMagicBytes), nil
+}
+
+// UploadJob describes a single artifact to upload to Installr.
+type UploadJob struct {
+	Type ArtifactType
+	Path string
+}
+
+// detectArtifactType infers an ArtifactType from a file's extension.
+func detectArtifactType(path string) (ArtifactType, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ipa":
+		return ArtifactTypeIPA, nil
+	case ".apk":
+		return ArtifactTypeAPK, nil
+	case ".aab":
+		return ArtifactTypeAAB, nil
+	case ".zip", ".dsym":
+		return ArtifactTypeDSYM, nil
+	default:
+		return "", fmt.Errorf("unrecognized artifact extension for %s", path)
+	}
+}
+
+// newUploadJob validates that path exists and builds an UploadJob for it,
+// warning (but not failing) if the file extension doesn't match the
+// expected artifactType.
+func newUploadJob(artifactType ArtifactType, path string) (UploadJob, error) {
+	if exist, err := IsPathExists(path); err != nil {
+		return UploadJob{}, fmt.Errorf("failed to check if path (%s) exists, error: %s", path, err)
+	} else if !exist {
+		return UploadJob{}, fmt.Errorf("no file found to deploy, specified path was: %s", path)
+	}
+
+	detected, err := detectArtifactType(path)
+	if err != nil {
+		// Extension didn't tell us anything (renamed or extension-less
+		// file) - fall back to sniffing the zip signature all of ipa,
+		// apk, aab, and zipped dSYM bundles share.
+		isZip, zipErr := looksLikeZipArchive(path)
+		if zipErr != nil {
+			return UploadJob{}, fmt.Errorf("failed to inspect %s, error: %s", path, zipErr)
+		}
+		if !isZip {
+			return UploadJob{}, fmt.Errorf("%s does not look like a %s file (unrecognized extension and not a zip archive)", path, artifactType)
+		}
+	} else if detected != artifactType {
+		logWarn("%s does not look like a %s file (detected %s)", path, artifactType, detected)
+	}
+
+	return UploadJob{Type: artifactType, Path: path}, nil
+}
+
+// FormField returns the multipart form field Installr expects the
+// artifact's file contents under.
+func (j UploadJob) FormField() string {
+	if j.Type == ArtifactTypeDSYM {
+		return "symbols_file"
+	}
+	return "qqfile"
+}
+
+// RequestURL returns the Installr endpoint this job should be posted to.
+func (j UploadJob) RequestURL() string {
+	if j.Type == ArtifactTypeDSYM {
+		return installrSymbolsURL
+	}
+	return installrAppsURL
+}
+
+// UploadResult is the outcome of uploading a single UploadJob.
+type UploadResult struct {
+	Job         UploadJob
+	Attempts    int
+	StatusCode  int
+	Result      string
+	BuildURL    string
+	AppID       string
+	BuildID     uint32
+	RawResponse string
+}
+
+// performUpload posts job to Installr, retrying according to retryCfg, and
+// parses the resulting InstallrAppResponse.
+func performUpload(client *http.Client, job UploadJob, apiToken string, fields map[string]string, retryCfg retryConfig) (UploadResult, error) {
+	files := map[string]string{
+		job.FormField(): job.Path,
+	}
+
+	newRequest := func() (*http.Request, error) {
+		request, err := createRequest(job.RequestURL(), fields, files)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Add("X-InstallrAppToken", apiToken)
+		return request, nil
+	}
+
+	response, attempts, requestErr := doRequestWithRetry(client, retryCfg, newRequest)
+	result := UploadResult{Job: job, Attempts: attempts}
+
+	if requestErr != nil && response == nil {
+		return result, fmt.Errorf("performing request failed, error: %s", requestErr)
+	}
+	defer response.Body.Close()
+
+	result.StatusCode = response.StatusCode
+
+	contents, readErr := ioutil.ReadAll(response.Body)
+	if readErr != nil {
+		return result, fmt.Errorf("failed to read response body, error: %s", readErr)
+	}
+	result.RawResponse = string(contents)
+
+	if requestErr != nil {
+		return result, fmt.Errorf("performing request failed, error: %s", requestErr)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 300 {
+		return result, fmt.Errorf("performing request failed, status code: %d", response.StatusCode)
+	}
+
+	iar := &InstallrAppResponse{}
+	if err := json.Unmarshal(contents, iar); err != nil {
+		return result, fmt.Errorf("failed to parse response body, error: %s", err)
+	}
+
+	result.Result = iar.Result
+	result.BuildURL = iar.AppData.LatestBuild.BuildFile.Url
+	result.AppID = iar.AppData.AppId
+	result.BuildID = iar.AppData.LatestBuild.Id
+
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectArtifactType(t *testing.T) {
+	cases := []struct {
+		name    string
+		path    string
+		want    ArtifactType
+		wantErr bool
+	}{
+		{"ipa", "build.ipa", ArtifactTypeIPA, false},
+		{"apk", "build.APK", ArtifactTypeAPK, false},
+		{"aab", "build.aab", ArtifactTypeAAB, false},
+		{"dsym zip", "build.dSYM.zip", ArtifactTypeDSYM, false},
+		{"dsym", "build.dsym", ArtifactTypeDSYM, false},
+		{"unrecognized", "build.txt", "", true},
+		{"no extension", "build", "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := detectArtifactType(c.path)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("detectArtifactType(%q) error = %v, wantErr %v", c.path, err, c.wantErr)
+			}
+			if err == nil && got != c.want {
+				t.Errorf("detectArtifactType(%q) = %s, want %s", c.path, got, c.want)
+			}
+		})
+	}
+}
+
+func TestLooksLikeZipArchive(t *testing.T) {
+	dir := t.TempDir()
+
+	zipPath := filepath.Join(dir, "archive.bin")
+	if err := ioutil.WriteFile(zipPath, append([]byte{0x50, 0x4B, 0x03, 0x04}, "rest of the zip"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nonZipPath := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(nonZipPath, []byte("just some text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyPath := filepath.Join(dir, "empty.bin")
+	if err := ioutil.WriteFile(emptyPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"zip signature", zipPath, true},
+		{"plain text", nonZipPath, false},
+		{"too short to be a zip", emptyPath, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := looksLikeZipArchive(c.path)
+			if err != nil {
+				t.Fatalf("looksLikeZipArchive(%q) error = %s", c.path, err)
+			}
+			if got != c.want {
+				t.Errorf("looksLikeZipArchive(%q) = %v, want %v", c.path, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// -----------------------
+// --- Post-deploy polling and webhooks
+// -----------------------
+
+const (
+	buildStatusReady      = "ready"
+	buildStatusFailed     = "failed"
+	buildStatusProcessing = "processing"
+	finalStateNotPolled   = "not_polled"
+	finalStateTimedOut    = "timeout"
+	webhookFormatSlack    = "slack"
+	defaultPollTimeout    = 5 * time.Minute
+	defaultPollInterval   = 10 * time.Second
+)
+
+// installrBuildStatusURLFormat builds the build status endpoint URL; a
+// var (rather than a const) so tests can point it at an httptest.Server.
+var installrBuildStatusURLFormat = "https://www.installrapp.com/apps/%s/builds/%d.json"
+
+// installrBuildStatusResponse is the shape of Installr's build status
+// endpoint, used while polling for processing completion.
+type installrBuildStatusResponse struct {
+	Status string
+}
+
+// pollBuildStatus polls Installr for appID/buildID's processing status
+// every interval, returning the terminal status ("ready" or "failed") or
+// finalStateTimedOut if timeout elapses first.
+func pollBuildStatus(client *http.Client, apiToken, appID string, buildID uint32, timeout, interval time.Duration) (string, error) {
+	statusURL := fmt.Sprintf(installrBuildStatusURLFormat, appID, buildID)
+	deadline := time.Now().Add(timeout)
+
+	for {
+		request, err := http.NewRequest("GET", statusURL, nil)
+		if err != nil {
+			return "", err
+		}
+		request.Header.Add("X-InstallrAppToken", apiToken)
+
+		response, err := client.Do(request)
+		if err != nil {
+			return "", err
+		}
+		contents, readErr := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if readErr != nil {
+			return "", readErr
+		}
+
+		var status installrBuildStatusResponse
+		if err := json.Unmarshal(contents, &status); err != nil {
+			return "", err
+		}
+
+		if status.Status == buildStatusReady || status.Status == buildStatusFailed {
+			return status.Status, nil
+		}
+
+		if time.Now().After(deadline) {
+			return finalStateTimedOut, nil
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// webhookPayload is the generic JSON body posted to webhook_url.
+type webhookPayload struct {
+	Status     string   `json:"status"`
+	FinalState string   `json:"final_state"`
+	BuildURLs  []string `json:"build_urls"`
+}
+
+// slackWebhookPayload is the body posted when webhook_format is "slack".
+type slackWebhookPayload struct {
+	Text string `json:"text"`
+}
+
+// postWebhook notifies webhookURL of the deploy outcome, formatting the
+// body for Slack's incoming-webhook API when format is webhookFormatSlack.
+func postWebhook(client *http.Client, webhookURL, format, status, finalState string, buildURLs []string) error {
+	var body []byte
+	var err error
+
+	if format == webhookFormatSlack {
+		text := fmt.Sprintf("Installr deploy: *%s* (final state: %s)", status, finalState)
+		if len(buildURLs) > 0 {
+			text += "\n" + strings.Join(buildURLs, "\n")
+		}
+		body, err = json.Marshal(slackWebhookPayload{Text: text})
+	} else {
+		body, err = json.Marshal(webhookPayload{Status: status, FinalState: finalState, BuildURLs: buildURLs})
+	}
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook POST failed, status code: %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollBuildStatus(t *testing.T) {
+	cases := []struct {
+		name      string
+		responses []string
+		timeout   time.Duration
+		interval  time.Duration
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "ready on first poll",
+			responses: []string{buildStatusReady},
+			timeout:   time.Second,
+			interval:  time.Millisecond,
+			want:      buildStatusReady,
+		},
+		{
+			name:      "failed on first poll",
+			responses: []string{buildStatusFailed},
+			timeout:   time.Second,
+			interval:  time.Millisecond,
+			want:      buildStatusFailed,
+		},
+		{
+			name:      "processing then ready",
+			responses: []string{buildStatusProcessing, buildStatusProcessing, buildStatusReady},
+			timeout:   time.Second,
+			interval:  time.Millisecond,
+			want:      buildStatusReady,
+		},
+		{
+			name:      "times out while still processing",
+			responses: []string{buildStatusProcessing},
+			timeout:   20 * time.Millisecond,
+			interval:  5 * time.Millisecond,
+			want:      finalStateTimedOut,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			call := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := c.responses[call]
+				if call < len(c.responses)-1 {
+					call++
+				}
+				json.NewEncoder(w).Encode(installrBuildStatusResponse{Status: status})
+			}))
+			defer server.Close()
+
+			original := installrBuildStatusURLFormat
+			installrBuildStatusURLFormat = server.URL + "/apps/%s/builds/%d.json"
+			defer func() { installrBuildStatusURLFormat = original }()
+
+			got, err := pollBuildStatus(server.Client(), "token", "app1", 42, c.timeout, c.interval)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("pollBuildStatus() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && got != c.want {
+				t.Errorf("pollBuildStatus() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPostWebhookGeneric(t *testing.T) {
+	var received webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Fatalf("failed to decode webhook body: %s", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := postWebhook(server.Client(), server.URL, "generic", installrAppDeployStatusSuccess, buildStatusReady, []string{"https://example.com/build/1"})
+	if err != nil {
+		t.Fatalf("postWebhook() error = %s", err)
+	}
+
+	if received.Status != installrAppDeployStatusSuccess {
+		t.Errorf("Status = %q, want %q", received.Status, installrAppDeployStatusSuccess)
+	}
+	if received.FinalState != buildStatusReady {
+		t.Errorf("FinalState = %q, want %q", received.FinalState, buildStatusReady)
+	}
+	if len(received.BuildURLs) != 1 || received.BuildURLs[0] != "https://example.com/build/1" {
+		t.Errorf("BuildURLs = %v, want [https://example.com/build/1]", received.BuildURLs)
+	}
+}
+
+func TestPostWebhookSlack(t *testing.T) {
+	var received slackWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Fatalf("failed to decode webhook body: %s", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := postWebhook(server.Client(), server.URL, webhookFormatSlack, installrAppDeployStatusFailed, finalStateTimedOut, nil)
+	if err != nil {
+		t.Fatalf("postWebhook() error = %s", err)
+	}
+
+	if received.Text == "" {
+		t.Error("Text is empty")
+	}
+	if !strings.Contains(received.Text, installrAppDeployStatusFailed) || !strings.Contains(received.Text, finalStateTimedOut) {
+		t.Errorf("Text = %q, want it to mention status %q and final state %q", received.Text, installrAppDeployStatusFailed, finalStateTimedOut)
+	}
+}
+
+func TestPostWebhookNonOKStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := postWebhook(server.Client(), server.URL, "generic", installrAppDeployStatusSuccess, buildStatusReady, nil); err == nil {
+		t.Error("postWebhook() error = nil, want an error for a non-2xx response")
+	}
+}